@@ -0,0 +1,176 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package syscore
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/template"
+)
+
+func init() {
+	RegisterSystem("freebsd-rcd", isRCD, func(i Interface, platform string, c *Config) (Service, error) {
+		return newRCDService(i, platform, c)
+	})
+}
+
+func isRCD() bool {
+	if _, err := os.Stat("/usr/local/etc/rc.d"); err != nil {
+		return false
+	}
+	_, err := exec.LookPath("service")
+	return err == nil
+}
+
+type rcd struct {
+	i        Interface
+	platform string
+	*Config
+}
+
+func newRCDService(i Interface, platform string, c *Config) (Service, error) {
+	return &rcd{i: i, platform: platform, Config: c}, nil
+}
+
+func (s *rcd) String() string {
+	if len(s.DisplayName) > 0 {
+		return s.DisplayName
+	}
+	return s.Name
+}
+
+func (s *rcd) Platform() string {
+	return s.platform
+}
+
+func (s *rcd) configPath() string {
+	return "/usr/local/etc/rc.d/" + s.Name
+}
+
+func (s *rcd) template() *template.Template {
+	return template.Must(template.New("").Funcs(tf).Parse(rcdScript))
+}
+
+func (s *rcd) Install() error {
+	cp := s.configPath()
+	if _, err := os.Stat(cp); err == nil {
+		return fmt.Errorf("Init already exists: %s", cp)
+	}
+
+	f, err := os.OpenFile(cp, os.O_WRONLY|os.O_CREATE, 0o755)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	path, err := s.execPath()
+	if err != nil {
+		return err
+	}
+
+	to := &struct {
+		*Config
+		Path string
+	}{s.Config, path}
+
+	if err := s.template().Execute(f, to); err != nil {
+		return err
+	}
+
+	return s.runAction("enable")
+}
+
+func (s *rcd) Uninstall() error {
+	if err := s.runAction("disable"); err != nil {
+		return err
+	}
+	return os.Remove(s.configPath())
+}
+
+func (s *rcd) Logger(errs chan<- error) (Logger, error) {
+	if system.Interactive() {
+		return ConsoleLogger, nil
+	}
+	return s.SystemLogger(errs)
+}
+
+func (s *rcd) SystemLogger(errs chan<- error) (Logger, error) {
+	return newSysLogger(s.Name, errs)
+}
+
+func (s *rcd) Run() (err error) {
+	err = s.i.Start(s)
+	if err != nil {
+		return err
+	}
+
+	s.Option.funcSingle(optionRunWait, func() {
+		sigChan := make(chan os.Signal, 3)
+		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
+		<-sigChan
+	})()
+
+	return s.i.Stop(s)
+}
+
+// Status reports the service state by parsing "service <name> onestatus",
+// the only introspection rc.d offers short of reading the pidfile by hand.
+func (s *rcd) Status() (Status, error) {
+	if _, err := os.Stat(s.configPath()); err != nil {
+		return StatusUnknown, ErrNotInstalled
+	}
+
+	_, out, err := runWithOutput("service", s.Name, "onestatus")
+	if err != nil {
+		if strings.Contains(out, "is not running") {
+			return StatusStopped, nil
+		}
+		return StatusUnknown, err
+	}
+	if strings.Contains(out, "is running") {
+		return StatusRunning, nil
+	}
+	return StatusStopped, nil
+}
+
+func (s *rcd) Start() error {
+	return s.runAction("start")
+}
+
+func (s *rcd) Stop() error {
+	return s.runAction("stop")
+}
+
+func (s *rcd) Restart() error {
+	return s.runAction("restart")
+}
+
+func (s *rcd) runAction(action string) error {
+	return run("service", s.Name, action)
+}
+
+const rcdScript = `#!/bin/sh
+#
+# PROVIDE: {{.Name}}
+# REQUIRE: LOGIN
+# KEYWORD: shutdown
+
+. /etc/rc.subr
+
+name="{{.Name}}"
+rcvar="${name}_enable"
+command="{{.Path|cmdEscape}}"
+{{if .WorkingDirectory}}command_chdir="{{.WorkingDirectory|cmdEscape}}"
+{{end -}}
+pidfile="/var/run/${name}.pid"
+command_args="{{range .Arguments}} {{.|cmd}}{{end}} &"
+
+load_rc_config $name
+run_rc_command "$1"
+`
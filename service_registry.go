@@ -0,0 +1,55 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package syscore
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNoServiceSystemDetected is returned by DetectSystem when no registered
+// backend's detect func reports itself as usable on the current host.
+var ErrNoServiceSystemDetected = errors.New("syscore: no supported service-management system detected")
+
+type registeredSystem struct {
+	name    string
+	detect  func() bool
+	factory func(Interface, string, *Config) (Service, error)
+}
+
+var (
+	systemRegistryMu sync.Mutex
+	systemRegistry   []registeredSystem
+)
+
+// RegisterSystem adds a candidate service-management backend to the
+// detection registry. Backends are tried in registration order by
+// DetectSystem, which uses the first one whose detect func returns true.
+//
+// Platform backends register themselves from an init func in their own
+// build-tagged file (see service_systemd_linux.go, service_freebsd.go), so
+// adding support for a new init system never requires patching a central
+// switch statement.
+func RegisterSystem(name string, detect func() bool, factory func(Interface, string, *Config) (Service, error)) {
+	systemRegistryMu.Lock()
+	defer systemRegistryMu.Unlock()
+	systemRegistry = append(systemRegistry, registeredSystem{name: name, detect: detect, factory: factory})
+}
+
+// DetectSystem runs the registered detectors in priority order and builds a
+// Service from the first one that matches the current host.
+func DetectSystem(i Interface, platform string, c *Config) (Service, error) {
+	systemRegistryMu.Lock()
+	entries := make([]registeredSystem, len(systemRegistry))
+	copy(entries, systemRegistry)
+	systemRegistryMu.Unlock()
+
+	for _, e := range entries {
+		if e.detect() {
+			return e.factory(i, platform, c)
+		}
+	}
+	return nil, ErrNoServiceSystemDetected
+}
@@ -0,0 +1,65 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package syscore
+
+import "testing"
+
+// withCleanRegistry runs fn against an empty registry and restores whatever
+// was registered (by this package's platform init funcs) afterwards, so
+// tests don't leak state into each other or into the real backends.
+func withCleanRegistry(t *testing.T, fn func()) {
+	t.Helper()
+	systemRegistryMu.Lock()
+	saved := systemRegistry
+	systemRegistry = nil
+	systemRegistryMu.Unlock()
+
+	t.Cleanup(func() {
+		systemRegistryMu.Lock()
+		systemRegistry = saved
+		systemRegistryMu.Unlock()
+	})
+
+	fn()
+}
+
+func TestDetectSystemUsesFirstMatch(t *testing.T) {
+	withCleanRegistry(t, func() {
+		var built string
+
+		RegisterSystem("first", func() bool { return false }, func(i Interface, platform string, c *Config) (Service, error) {
+			built = "first"
+			return nil, nil
+		})
+		RegisterSystem("second", func() bool { return true }, func(i Interface, platform string, c *Config) (Service, error) {
+			built = "second"
+			return nil, nil
+		})
+		RegisterSystem("third", func() bool { return true }, func(i Interface, platform string, c *Config) (Service, error) {
+			built = "third"
+			return nil, nil
+		})
+
+		if _, err := DetectSystem(nil, "linux", &Config{}); err != nil {
+			t.Fatalf("DetectSystem returned err: %v", err)
+		}
+		if built != "second" {
+			t.Errorf("DetectSystem built %q, want %q (first matching detector, in registration order)", built, "second")
+		}
+	})
+}
+
+func TestDetectSystemNoMatch(t *testing.T) {
+	withCleanRegistry(t, func() {
+		RegisterSystem("never", func() bool { return false }, func(i Interface, platform string, c *Config) (Service, error) {
+			return nil, nil
+		})
+
+		_, err := DetectSystem(nil, "linux", &Config{})
+		if err != ErrNoServiceSystemDetected {
+			t.Errorf("DetectSystem err = %v, want %v", err, ErrNoServiceSystemDetected)
+		}
+	})
+}
@@ -0,0 +1,340 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package syscore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+)
+
+// Option keys carrying companion-unit specs. These follow the same pattern
+// as optionSystemdScript: structured values too rich for a single scalar are
+// threaded through Config.Option rather than growing the Config struct.
+const (
+	optionSocketActivation = "SocketActivation"
+	optionTimer            = "Timer"
+	optionPaths            = "Paths"
+
+	// optionActivationOnly drops the main .service unit's own [Install]
+	// section (so it no longer starts via WantedBy=multi-user.target at
+	// boot) when at least one companion activation unit is configured,
+	// letting that socket/timer/path unit be the sole trigger instead.
+	// It has no effect without a companion unit: a plain service still
+	// needs its own [Install] to be enableable at all.
+	optionActivationOnly        = "ActivationOnly"
+	optionActivationOnlyDefault = false
+)
+
+// SocketSpec describes one systemd .socket unit to install alongside the
+// service, activating it on first connection instead of at boot. With Accept
+// set, systemd starts an instance of the <name>@.service template per
+// connection instead; Install does not write that template unit.
+type SocketSpec struct {
+	ListenStream       string
+	ListenDatagram     string
+	ListenFIFO         string
+	Accept             bool
+	SocketMode         string
+	FileDescriptorName string
+}
+
+// TimerSpec describes a systemd .timer unit that activates the service on a
+// schedule instead of (or in addition to) WantedBy=multi-user.target.
+type TimerSpec struct {
+	OnCalendar         string
+	OnBootSec          string
+	OnUnitActiveSec    string
+	Persistent         bool
+	RandomizedDelaySec string
+}
+
+// PathSpec describes a systemd .path unit that activates the service when a
+// watched path changes.
+type PathSpec struct {
+	PathExists   string
+	PathChanged  string
+	PathModified string
+}
+
+func (s *systemd) socketSpecs() []SocketSpec {
+	specs, _ := s.Option[optionSocketActivation].([]SocketSpec)
+	return specs
+}
+
+func (s *systemd) timerSpec() *TimerSpec {
+	t, _ := s.Option[optionTimer].(*TimerSpec)
+	return t
+}
+
+func (s *systemd) pathSpecs() []PathSpec {
+	specs, _ := s.Option[optionPaths].([]PathSpec)
+	return specs
+}
+
+func (s *systemd) socketUnitName(i, total int) string {
+	if total <= 1 {
+		return s.Config.Name + ".socket"
+	}
+	return fmt.Sprintf("%s-%d.socket", s.Config.Name, i)
+}
+
+func (s *systemd) timerUnitName() string {
+	return s.Config.Name + ".timer"
+}
+
+func (s *systemd) pathUnitName(i, total int) string {
+	if total <= 1 {
+		return s.Config.Name + ".path"
+	}
+	return fmt.Sprintf("%s-%d.path", s.Config.Name, i)
+}
+
+// companionConfigPath mirrors configPath for a companion unit file name.
+func (s *systemd) companionConfigPath(unitName string) (string, error) {
+	if !s.isUserService() {
+		return "/etc/systemd/system/" + unitName, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(homeDir, ".config/systemd/user")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, unitName), nil
+}
+
+func (s *systemd) writeCompanionUnit(unitName string, tmpl *template.Template, data interface{}) error {
+	cp, err := s.companionConfigPath(unitName)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(cp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return tmpl.Execute(f, data)
+}
+
+// companionUnitNames lists the unit file names installCompanionUnits writes
+// for the currently configured SocketActivation/Timer/Paths specs.
+func (s *systemd) companionUnitNames() []string {
+	var names []string
+	sockets := s.socketSpecs()
+	for i := range sockets {
+		names = append(names, s.socketUnitName(i, len(sockets)))
+	}
+	if s.timerSpec() != nil {
+		names = append(names, s.timerUnitName())
+	}
+	paths := s.pathSpecs()
+	for i := range paths {
+		names = append(names, s.pathUnitName(i, len(paths)))
+	}
+	return names
+}
+
+// mainUnitEnableable reports whether Install should still enable the main
+// .service unit against multi-user.target. It's false only when the caller
+// opted into ActivationOnly and actually configured a companion unit to
+// take over triggering the service instead.
+func (s *systemd) mainUnitEnableable() bool {
+	if len(s.companionUnitNames()) == 0 {
+		return true
+	}
+	return !s.Option.bool(optionActivationOnly, optionActivationOnlyDefault)
+}
+
+// installCompanionUnits writes the .socket/.timer/.path units declared via
+// Config.Option as siblings of the main .service unit, then enables and
+// starts each of them so activation actually takes effect rather than
+// leaving freshly written unit files inert until someone runs
+// "systemctl enable --now" by hand.
+func (s *systemd) installCompanionUnits() error {
+	sockets := s.socketSpecs()
+	for i, spec := range sockets {
+		data := &struct {
+			SocketSpec
+			Description string
+			UnitName    string
+		}{spec, s.Description, s.unitName()}
+		if err := s.writeCompanionUnit(s.socketUnitName(i, len(sockets)), socketUnitTemplate, data); err != nil {
+			return err
+		}
+	}
+
+	if timer := s.timerSpec(); timer != nil {
+		data := &struct {
+			*TimerSpec
+			Description string
+			UnitName    string
+		}{timer, s.Description, s.unitName()}
+		if err := s.writeCompanionUnit(s.timerUnitName(), timerUnitTemplate, data); err != nil {
+			return err
+		}
+	}
+
+	paths := s.pathSpecs()
+	for i, spec := range paths {
+		data := &struct {
+			PathSpec
+			Description string
+			UnitName    string
+		}{spec, s.Description, s.unitName()}
+		if err := s.writeCompanionUnit(s.pathUnitName(i, len(paths)), pathUnitTemplate, data); err != nil {
+			return err
+		}
+	}
+
+	names := s.companionUnitNames()
+	if len(names) == 0 {
+		return nil
+	}
+
+	if err := s.daemonReload(); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := s.enableNowUnit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uninstallCompanionUnits disables and stops whatever companion units
+// installCompanionUnits enabled, then removes their unit files, tolerating
+// units that were never installed.
+func (s *systemd) uninstallCompanionUnits() error {
+	names := s.companionUnitNames()
+
+	for _, name := range names {
+		if err := s.disableNowUnit(name); err != nil && !isUnitNotLoadedErr(err) {
+			return err
+		}
+	}
+	for _, name := range names {
+		cp, err := s.companionConfigPath(name)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(cp); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+var socketUnitTemplate = template.Must(template.New("socket").Parse(`[Unit]
+Description={{.Description}}
+
+[Socket]
+{{if .ListenStream}}ListenStream={{.ListenStream}}
+{{end -}}
+{{if .ListenDatagram}}ListenDatagram={{.ListenDatagram}}
+{{end -}}
+{{if .ListenFIFO}}ListenFIFO={{.ListenFIFO}}
+{{end -}}
+Accept={{.Accept}}
+{{if .SocketMode}}SocketMode={{.SocketMode}}
+{{end -}}
+{{if .FileDescriptorName}}FileDescriptorName={{.FileDescriptorName}}
+{{end -}}
+{{if not .Accept}}Service={{.UnitName}}
+{{end -}}
+
+[Install]
+WantedBy=sockets.target
+`))
+
+var timerUnitTemplate = template.Must(template.New("timer").Parse(`[Unit]
+Description={{.Description}}
+
+[Timer]
+{{if .OnCalendar}}OnCalendar={{.OnCalendar}}
+{{end -}}
+{{if .OnBootSec}}OnBootSec={{.OnBootSec}}
+{{end -}}
+{{if .OnUnitActiveSec}}OnUnitActiveSec={{.OnUnitActiveSec}}
+{{end -}}
+Persistent={{.Persistent}}
+{{if .RandomizedDelaySec}}RandomizedDelaySec={{.RandomizedDelaySec}}
+{{end -}}
+Unit={{.UnitName}}
+
+[Install]
+WantedBy=timers.target
+`))
+
+var pathUnitTemplate = template.Must(template.New("path").Parse(`[Unit]
+Description={{.Description}}
+
+[Path]
+{{if .PathExists}}PathExists={{.PathExists}}
+{{end -}}
+{{if .PathChanged}}PathChanged={{.PathChanged}}
+{{end -}}
+{{if .PathModified}}PathModified={{.PathModified}}
+{{end -}}
+Unit={{.UnitName}}
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// listenFDsStart is the first file descriptor systemd hands to an
+// activated process; descriptors 0-2 remain stdin/stdout/stderr.
+const listenFDsStart = 3
+
+// ActivationFiles returns the file descriptors systemd passed to this
+// process via socket/FIFO activation (LISTEN_FDS/LISTEN_PID/LISTEN_FDNAMES),
+// so a program built against this module can accept systemd-managed sockets
+// without depending on a separate activation library. It returns a nil
+// slice, not an error, when this process wasn't socket-activated.
+func ActivationFiles() ([]*os.File, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	files := make([]*os.File, 0, nfds)
+	for i := 0; i < nfds; i++ {
+		fd := listenFDsStart + i
+		// Dup so the caller owns an independent descriptor, then close the
+		// original inherited one (otherwise it leaks for the process's
+		// lifetime) and mark the dup CLOEXEC so it doesn't survive a
+		// subsequent re-exec of this program.
+		dupFd, err := syscall.Dup(fd)
+		if err != nil {
+			return nil, fmt.Errorf("syscore: dup listen fd %d: %w", fd, err)
+		}
+		syscall.Close(fd)
+		syscall.CloseOnExec(dupFd)
+
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		files = append(files, os.NewFile(uintptr(dupFd), name))
+	}
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	return files, nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package syscore
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestActivationFilesNoEnv(t *testing.T) {
+	t.Setenv("LISTEN_PID", "")
+	t.Setenv("LISTEN_FDS", "")
+
+	files, err := ActivationFiles()
+	if err != nil {
+		t.Fatalf("ActivationFiles returned err: %v", err)
+	}
+	if files != nil {
+		t.Errorf("ActivationFiles = %v, want nil when LISTEN_PID/LISTEN_FDS are unset", files)
+	}
+}
+
+func TestActivationFilesPIDMismatch(t *testing.T) {
+	// A PID that can never be this process.
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+
+	files, err := ActivationFiles()
+	if err != nil {
+		t.Fatalf("ActivationFiles returned err: %v", err)
+	}
+	if files != nil {
+		t.Errorf("ActivationFiles = %v, want nil when LISTEN_PID doesn't match this process", files)
+	}
+}
+
+func TestActivationFilesZeroFDs(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "0")
+
+	files, err := ActivationFiles()
+	if err != nil {
+		t.Fatalf("ActivationFiles returned err: %v", err)
+	}
+	if files != nil {
+		t.Errorf("ActivationFiles = %v, want nil when LISTEN_FDS is 0", files)
+	}
+}
+
+func TestSocketUnitName(t *testing.T) {
+	s := &systemd{Config: &Config{Name: "myservice"}}
+
+	if got := s.socketUnitName(0, 1); got != "myservice.socket" {
+		t.Errorf("socketUnitName(0, 1) = %q, want %q", got, "myservice.socket")
+	}
+	if got := s.socketUnitName(0, 2); got != "myservice-0.socket" {
+		t.Errorf("socketUnitName(0, 2) = %q, want %q", got, "myservice-0.socket")
+	}
+	if got := s.socketUnitName(1, 2); got != "myservice-1.socket" {
+		t.Errorf("socketUnitName(1, 2) = %q, want %q", got, "myservice-1.socket")
+	}
+}
+
+func TestPathUnitName(t *testing.T) {
+	s := &systemd{Config: &Config{Name: "myservice"}}
+
+	if got := s.pathUnitName(0, 1); got != "myservice.path" {
+		t.Errorf("pathUnitName(0, 1) = %q, want %q", got, "myservice.path")
+	}
+	if got := s.pathUnitName(2, 3); got != "myservice-2.path" {
+		t.Errorf("pathUnitName(2, 3) = %q, want %q", got, "myservice-2.path")
+	}
+}
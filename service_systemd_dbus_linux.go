@@ -0,0 +1,266 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package syscore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	sddbus "github.com/coreos/go-systemd/v22/dbus"
+)
+
+// dbusJobTimeout bounds how long we wait for a systemd job (start/stop/
+// restart/reload/enable) submitted over D-Bus to reach "done".
+const dbusJobTimeout = 30 * time.Second
+
+// UnitState is the runtime state of a systemd unit as reported over D-Bus.
+// It carries the fields systemctl's "is-active" string-parsing throws away.
+type UnitState struct {
+	ActiveState    string
+	SubState       string
+	LoadState      string
+	MainPID        uint32
+	ExecMainStatus int32
+}
+
+// useDbus reports whether this service should be controlled over D-Bus
+// rather than by shelling out to systemctl. It requires systemd to be PID 1
+// and a usable bus connection (the system bus needs root; the user bus needs
+// a running per-user systemd instance).
+func (s *systemd) useDbus() bool {
+	if !isSystemd() {
+		return false
+	}
+	_, err := s.busConn()
+	return err == nil
+}
+
+// dial opens a new connection to the appropriate D-Bus instance: the user
+// bus when running as a user service, the system bus otherwise.
+func (s *systemd) dial() (*sddbus.Conn, error) {
+	ctx := context.Background()
+	if s.isUserService() {
+		return sddbus.NewUserConnectionContext(ctx)
+	}
+	if os.Geteuid() != 0 {
+		return nil, errors.New("syscore: system bus control requires root")
+	}
+	return sddbus.NewSystemConnectionContext(ctx)
+}
+
+// busConn returns a cached D-Bus connection, dialing lazily on first use.
+func (s *systemd) busConn() (*sddbus.Conn, error) {
+	s.dbusMu.Lock()
+	defer s.dbusMu.Unlock()
+	if s.dbusConn != nil {
+		return s.dbusConn, nil
+	}
+	conn, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	s.dbusConn = conn
+	return conn, nil
+}
+
+// unitState fetches the live ActiveState/SubState/LoadState/MainPID/
+// ExecMainStatus of the unit over D-Bus.
+func (s *systemd) unitState() (UnitState, error) {
+	conn, err := s.busConn()
+	if err != nil {
+		return UnitState{}, err
+	}
+	props, err := conn.GetUnitPropertiesContext(context.Background(), s.unitName())
+	if err != nil {
+		return UnitState{}, err
+	}
+
+	var st UnitState
+	if v, ok := props["ActiveState"].(string); ok {
+		st.ActiveState = v
+	}
+	if v, ok := props["SubState"].(string); ok {
+		st.SubState = v
+	}
+	if v, ok := props["LoadState"].(string); ok {
+		st.LoadState = v
+	}
+	if v, ok := props["MainPID"].(uint32); ok {
+		st.MainPID = v
+	}
+	if v, ok := props["ExecMainStatus"].(int32); ok {
+		st.ExecMainStatus = v
+	}
+	return st, nil
+}
+
+func (s *systemd) statusDbus() (Status, error) {
+	st, err := s.unitState()
+	if err != nil {
+		return StatusUnknown, err
+	}
+
+	switch st.ActiveState {
+	case "active", "reloading", "activating":
+		return StatusRunning, nil
+	case "inactive", "deactivating":
+		if st.LoadState == "not-found" {
+			return StatusUnknown, ErrNotInstalled
+		}
+		return StatusStopped, nil
+	case "failed":
+		return StatusUnknown, errors.New("service in failed state")
+	default:
+		return StatusUnknown, ErrNotInstalled
+	}
+}
+
+// waitJob blocks until the systemd job queued on ch completes, returning an
+// error if it didn't finish with result "done".
+func waitJob(ch chan string) error {
+	select {
+	case result := <-ch:
+		if result != "done" {
+			return fmt.Errorf("syscore: systemd job finished with result %q", result)
+		}
+		return nil
+	case <-time.After(dbusJobTimeout):
+		return errors.New("syscore: timed out waiting for systemd job")
+	}
+}
+
+func (s *systemd) startDbus() error {
+	return s.startUnitDbus(s.unitName())
+}
+
+func (s *systemd) stopDbus() error {
+	return s.stopUnitDbus(s.unitName())
+}
+
+func (s *systemd) startUnitDbus(unit string) error {
+	conn, err := s.busConn()
+	if err != nil {
+		return err
+	}
+	ch := make(chan string, 1)
+	if _, err := conn.StartUnitContext(context.Background(), unit, "replace", ch); err != nil {
+		return err
+	}
+	return waitJob(ch)
+}
+
+func (s *systemd) stopUnitDbus(unit string) error {
+	conn, err := s.busConn()
+	if err != nil {
+		return err
+	}
+	ch := make(chan string, 1)
+	if _, err := conn.StopUnitContext(context.Background(), unit, "replace", ch); err != nil {
+		return err
+	}
+	return waitJob(ch)
+}
+
+func (s *systemd) restartDbus() error {
+	conn, err := s.busConn()
+	if err != nil {
+		return err
+	}
+	ch := make(chan string, 1)
+	if _, err := conn.RestartUnitContext(context.Background(), s.unitName(), "replace", ch); err != nil {
+		return err
+	}
+	return waitJob(ch)
+}
+
+func (s *systemd) reloadDbus() error {
+	conn, err := s.busConn()
+	if err != nil {
+		return err
+	}
+	ch := make(chan string, 1)
+	if _, err := conn.ReloadUnitContext(context.Background(), s.unitName(), "replace", ch); err != nil {
+		return err
+	}
+	return waitJob(ch)
+}
+
+func (s *systemd) enableDisableDbus(action string) error {
+	return s.enableDisableUnitDbus(s.unitName(), action)
+}
+
+func (s *systemd) enableDisableUnitDbus(unit, action string) error {
+	conn, err := s.busConn()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	switch action {
+	case "enable":
+		_, _, err = conn.EnableUnitFilesContext(ctx, []string{unit}, false, true)
+	case "disable":
+		_, err = conn.DisableUnitFilesContext(ctx, []string{unit}, false)
+	default:
+		return fmt.Errorf("syscore: unsupported dbus action %q", action)
+	}
+	return err
+}
+
+func (s *systemd) daemonReloadDbus() error {
+	conn, err := s.busConn()
+	if err != nil {
+		return err
+	}
+	return conn.ReloadContext(context.Background())
+}
+
+// WatchProperties streams unit property changes (ActiveState/SubState) until
+// ctx is cancelled, for callers that want to observe service transitions
+// without polling Status.
+func (s *systemd) WatchProperties(ctx context.Context) (<-chan UnitState, error) {
+	conn, err := s.busConn()
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Subscribe(); err != nil {
+		return nil, err
+	}
+
+	set := conn.NewSubscriptionSet()
+	set.Add(s.unitName())
+	updates, errs := set.Subscribe()
+
+	out := make(chan UnitState)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err := <-errs:
+				if err != nil {
+					return
+				}
+			case units, ok := <-updates:
+				if !ok {
+					return
+				}
+				us, ok := units[s.unitName()]
+				if !ok || us == nil {
+					continue
+				}
+				select {
+				case out <- UnitState{ActiveState: us.ActiveState, SubState: us.SubState, LoadState: us.LoadState}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package syscore
+
+// Option keys for the systemd sandboxing/hardening directives. Defaults are
+// all "off": installs stay behaviorally unchanged unless a caller opts in
+// via Config.Option.
+const (
+	optionProtectSystem        = "ProtectSystem"
+	optionProtectSystemDefault = ""
+
+	optionProtectHome        = "ProtectHome"
+	optionProtectHomeDefault = ""
+
+	optionPrivateTmp        = "PrivateTmp"
+	optionPrivateTmpDefault = false
+
+	optionPrivateDevices        = "PrivateDevices"
+	optionPrivateDevicesDefault = false
+
+	optionNoNewPrivileges        = "NoNewPrivileges"
+	optionNoNewPrivilegesDefault = false
+
+	optionCapabilityBoundingSet        = "CapabilityBoundingSet"
+	optionCapabilityBoundingSetDefault = ""
+
+	optionAmbientCapabilities        = "AmbientCapabilities"
+	optionAmbientCapabilitiesDefault = ""
+
+	// ReadWritePaths/ReadOnlyPaths take a systemd-style space-separated
+	// list of paths, same as the unit directive itself.
+	optionReadWritePaths        = "ReadWritePaths"
+	optionReadWritePathsDefault = ""
+
+	optionReadOnlyPaths        = "ReadOnlyPaths"
+	optionReadOnlyPathsDefault = ""
+
+	optionSystemCallFilter        = "SystemCallFilter"
+	optionSystemCallFilterDefault = ""
+
+	optionRestrictAddressFamilies        = "RestrictAddressFamilies"
+	optionRestrictAddressFamiliesDefault = ""
+
+	optionMemoryMax        = "MemoryMax"
+	optionMemoryMaxDefault = ""
+
+	optionCPUQuota        = "CPUQuota"
+	optionCPUQuotaDefault = ""
+
+	optionTasksMax        = "TasksMax"
+	optionTasksMaxDefault = ""
+
+	optionOOMScoreAdjust        = "OOMScoreAdjust"
+	optionOOMScoreAdjustDefault = ""
+)
+
+// hardeningMinVersion maps each hardening option key to the systemd version
+// that introduced the corresponding unit directive. Options missing from
+// this map are assumed to have always been supported.
+var hardeningMinVersion = map[string]int64{
+	optionPrivateTmp:              183,
+	optionCapabilityBoundingSet:   186,
+	optionSystemCallFilter:        187,
+	optionNoNewPrivileges:         187,
+	optionOOMScoreAdjust:          188,
+	optionPrivateDevices:          209,
+	optionRestrictAddressFamilies: 211,
+	optionCPUQuota:                213,
+	optionProtectSystem:           214,
+	optionProtectHome:             214,
+	optionTasksMax:                227,
+	optionAmbientCapabilities:     229,
+	optionMemoryMax:               230,
+	optionReadWritePaths:          231,
+	optionReadOnlyPaths:           231,
+}
+
+// hardeningSupportedAtVersion reports whether systemd version would support
+// the unit directive behind the given option key. A version of -1 (unknown)
+// is treated as supported, same as a directive missing from
+// hardeningMinVersion entirely: directives are only ever dropped when we can
+// positively confirm they predate the running systemd.
+func hardeningSupportedAtVersion(option string, version int64) bool {
+	min, ok := hardeningMinVersion[option]
+	if !ok {
+		return true
+	}
+	if version == -1 {
+		return true
+	}
+	return version >= min
+}
+
+// hardeningString reads a string hardening option, dropping it (returning
+// "") when version predates the directive. version is the running
+// systemd's version, as returned by getSystemdVersion and shared across a
+// single Install() call rather than re-derived per option.
+func (s *systemd) hardeningString(option, def string, version int64) string {
+	if !hardeningSupportedAtVersion(option, version) {
+		return ""
+	}
+	return s.Option.string(option, def)
+}
+
+// hardeningBool reads a boolean hardening option, dropping it (returning
+// false) when version predates the directive. version is the running
+// systemd's version, as returned by getSystemdVersion and shared across a
+// single Install() call rather than re-derived per option.
+func (s *systemd) hardeningBool(option string, def bool, version int64) bool {
+	if !hardeningSupportedAtVersion(option, version) {
+		return false
+	}
+	return s.Option.bool(option, def)
+}
@@ -0,0 +1,33 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package syscore
+
+import "testing"
+
+func TestHardeningSupportedAtVersion(t *testing.T) {
+	cases := []struct {
+		option  string
+		version int64
+		want    bool
+	}{
+		{optionPrivateTmp, 183, true},
+		{optionPrivateTmp, 182, false},
+		{optionProtectSystem, 213, false},
+		{optionProtectSystem, 214, true},
+		{optionReadWritePaths, 230, false},
+		{optionReadWritePaths, 231, true},
+		// unknown version: never drop a directive we can't disprove support for.
+		{optionProtectSystem, -1, true},
+		// option with no recorded minimum: always supported.
+		{optionRestart, 1, true},
+	}
+
+	for _, c := range cases {
+		got := hardeningSupportedAtVersion(c.option, c.version)
+		if got != c.want {
+			t.Errorf("hardeningSupportedAtVersion(%q, %d) = %v, want %v", c.option, c.version, got, c.want)
+		}
+	}
+}
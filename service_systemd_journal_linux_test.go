@@ -0,0 +1,74 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package syscore
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+)
+
+func TestEncodeJournalFields(t *testing.T) {
+	out := string(encodeJournalFields(map[string]string{
+		"PRIORITY": "6",
+		"MESSAGE":  "hello world",
+	}))
+
+	if !strings.Contains(out, "PRIORITY=6\n") {
+		t.Errorf("encodeJournalFields missing PRIORITY line, got %q", out)
+	}
+	if !strings.Contains(out, "MESSAGE=hello world\n") {
+		t.Errorf("encodeJournalFields missing MESSAGE line, got %q", out)
+	}
+}
+
+func TestEncodeJournalFieldsMultiline(t *testing.T) {
+	value := "line one\nline two"
+	out := string(encodeJournalFields(map[string]string{"MESSAGE": value}))
+
+	// Multiline values use the length-prefixed form: key, newline, 8-byte
+	// little-endian length, value, newline - never a bare "KEY=value".
+	if strings.Contains(out, "MESSAGE="+value) {
+		t.Errorf("multiline field was encoded in the plain KEY=VALUE form: %q", out)
+	}
+	if !strings.HasPrefix(out, "MESSAGE\n") {
+		t.Errorf("multiline field should start with the bare key, got %q", out)
+	}
+	if !strings.Contains(out, value) {
+		t.Errorf("encoded payload missing original value: %q", out)
+	}
+}
+
+func TestEntryFromJournal(t *testing.T) {
+	je := &sdjournal.JournalEntry{
+		Fields: map[string]string{
+			"MESSAGE":  "boot ok",
+			"PRIORITY": "6",
+		},
+		RealtimeTimestamp: 1700000000000000,
+	}
+
+	entry := entryFromJournal("myservice", je)
+	if entry.Message != "boot ok" || entry.Priority != 6 || entry.Unit != "myservice" {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	if !entry.Timestamp.Equal(time.UnixMicro(1700000000000000)) {
+		t.Errorf("entry.Timestamp = %v, want derived from RealtimeTimestamp", entry.Timestamp)
+	}
+	if entry.Fields["MESSAGE"] != "boot ok" {
+		t.Errorf("entry.Fields should carry through the raw journal fields, got %+v", entry.Fields)
+	}
+}
+
+func TestEntryFromJournalMissingPriority(t *testing.T) {
+	je := &sdjournal.JournalEntry{Fields: map[string]string{"MESSAGE": "no priority field"}}
+
+	entry := entryFromJournal("myservice", je)
+	if entry.Priority != 0 {
+		t.Errorf("entry.Priority = %d, want 0 when PRIORITY is absent", entry.Priority)
+	}
+}
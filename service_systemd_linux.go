@@ -15,10 +15,19 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"text/template"
+
+	sddbus "github.com/coreos/go-systemd/v22/dbus"
 )
 
+func init() {
+	RegisterSystem("linux-systemd", isSystemd, func(i Interface, platform string, c *Config) (Service, error) {
+		return newSystemdService(i, platform, c)
+	})
+}
+
 func isSystemd() bool {
 	if _, err := os.Stat("/run/systemd/system"); err == nil {
 		return true
@@ -48,6 +57,18 @@ type systemd struct {
 	i        Interface
 	platform string
 	*Config
+
+	dbusMu   sync.Mutex
+	dbusConn *sddbus.Conn
+
+	watchdogMu   sync.Mutex
+	petCh        chan struct{}
+	watchdogStop chan struct{}
+	healthMu     sync.Mutex
+	healthCheck  func() error
+	reloadMu     sync.Mutex
+	reload       func() error
+	errs         chan<- error
 }
 
 func newSystemdService(i Interface, platform string, c *Config) (Service, error) {
@@ -113,9 +134,8 @@ func (s *systemd) getSystemdVersion() int64 {
 	return v
 }
 
-func (s *systemd) hasOutputFileSupport() bool {
+func (s *systemd) hasOutputFileSupport(version int64) bool {
 	defaultValue := true
-	version := s.getSystemdVersion()
 	if version == -1 {
 		return defaultValue
 	}
@@ -161,9 +181,15 @@ func (s *systemd) Install() error {
 		return err
 	}
 
+	// Computed once and threaded through hasOutputFileSupport/hardeningString/
+	// hardeningBool below instead of letting each of them shell out to
+	// "systemctl --version" again on its own.
+	version := s.getSystemdVersion()
+
 	to := &struct {
 		*Config
 		Path                 string
+		Type                 string
 		HasOutputFileSupport bool
 		ReloadSignal         string
 		PIDFile              string
@@ -176,10 +202,28 @@ func (s *systemd) Install() error {
 		KillMode             string
 		KillSignal           string
 		TimeoutStopSec       string
+		EnableMainUnit       bool
+
+		ProtectSystem           string
+		ProtectHome             string
+		PrivateTmp              bool
+		PrivateDevices          bool
+		NoNewPrivileges         bool
+		CapabilityBoundingSet   string
+		AmbientCapabilities     string
+		ReadWritePaths          string
+		ReadOnlyPaths           string
+		SystemCallFilter        string
+		RestrictAddressFamilies string
+		MemoryMax               string
+		CPUQuota                string
+		TasksMax                string
+		OOMScoreAdjust          string
 	}{
 		s.Config,
 		path,
-		s.hasOutputFileSupport(),
+		s.Option.string(optionType, optionTypeDefault), // simple/notify/forking/oneshot/dbus
+		s.hasOutputFileSupport(version),
 		s.Option.string(optionReloadSignal, "SIGHUP"),                                 // 重新加载配置时发送的信号，通常使用 SIGHUP
 		s.Option.string(optionPIDFile, fmt.Sprintf("/var/run/%s.pid", s.Config.Name)), // 指定服务的 PID 文件路径
 		s.Option.int(optionLimitNOFILE, optionLimitNOFILEDefault),                     // 打开的文件描述符限制，常用的默认值
@@ -191,6 +235,23 @@ func (s *systemd) Install() error {
 		s.Option.string(optionKillMode, "control-group"),                              // 杀死进程的模式，通常使用 control-group
 		s.Option.string(optionKillSignal, "SIGTERM"),                                  // 停止服务时发送的信号，通常使用 SIGTERM
 		s.Option.string(optionTimeoutStopSec, "30s"),                                  // 停止服务的超时时间，通常设置为 30 秒
+		s.mainUnitEnableable(),
+
+		s.hardeningString(optionProtectSystem, optionProtectSystemDefault, version),
+		s.hardeningString(optionProtectHome, optionProtectHomeDefault, version),
+		s.hardeningBool(optionPrivateTmp, optionPrivateTmpDefault, version),
+		s.hardeningBool(optionPrivateDevices, optionPrivateDevicesDefault, version),
+		s.hardeningBool(optionNoNewPrivileges, optionNoNewPrivilegesDefault, version),
+		s.hardeningString(optionCapabilityBoundingSet, optionCapabilityBoundingSetDefault, version),
+		s.hardeningString(optionAmbientCapabilities, optionAmbientCapabilitiesDefault, version),
+		s.hardeningString(optionReadWritePaths, optionReadWritePathsDefault, version),
+		s.hardeningString(optionReadOnlyPaths, optionReadOnlyPathsDefault, version),
+		s.hardeningString(optionSystemCallFilter, optionSystemCallFilterDefault, version),
+		s.hardeningString(optionRestrictAddressFamilies, optionRestrictAddressFamiliesDefault, version),
+		s.hardeningString(optionMemoryMax, optionMemoryMaxDefault, version),
+		s.hardeningString(optionCPUQuota, optionCPUQuotaDefault, version),
+		s.hardeningString(optionTasksMax, optionTasksMaxDefault, version),
+		s.hardeningString(optionOOMScoreAdjust, optionOOMScoreAdjustDefault, version),
 	}
 
 	err = s.template().Execute(f, to)
@@ -198,17 +259,26 @@ func (s *systemd) Install() error {
 		return err
 	}
 
-	err = s.runAction("enable")
-	if err != nil {
+	if err := s.installCompanionUnits(); err != nil {
 		return err
 	}
 
-	return s.run("daemon-reload")
+	if s.mainUnitEnableable() {
+		if err := s.enableAction("enable"); err != nil {
+			return err
+		}
+	}
+
+	return s.daemonReload()
 }
 
 func (s *systemd) Uninstall() error {
-	err := s.runAction("disable")
-	if err != nil {
+	if s.mainUnitEnableable() {
+		if err := s.enableAction("disable"); err != nil {
+			return err
+		}
+	}
+	if err := s.uninstallCompanionUnits(); err != nil {
 		return err
 	}
 	cp, err := s.configPath()
@@ -218,10 +288,11 @@ func (s *systemd) Uninstall() error {
 	if err := os.Remove(cp); err != nil {
 		return err
 	}
-	return s.run("daemon-reload")
+	return s.daemonReload()
 }
 
 func (s *systemd) Logger(errs chan<- error) (Logger, error) {
+	s.errs = errs
 	if system.Interactive() {
 		return ConsoleLogger, nil
 	}
@@ -229,6 +300,9 @@ func (s *systemd) Logger(errs chan<- error) (Logger, error) {
 }
 
 func (s *systemd) SystemLogger(errs chan<- error) (Logger, error) {
+	if l, err := newJournalLogger(s.Name, errs); err == nil {
+		return l, nil
+	}
 	return newSysLogger(s.Name, errs)
 }
 
@@ -238,16 +312,69 @@ func (s *systemd) Run() (err error) {
 		return err
 	}
 
+	notify := s.Option.string(optionType, optionTypeDefault) == "notify"
+	if notify {
+		_ = sdNotify(fmt.Sprintf("READY=1\nMAINPID=%d", os.Getpid()))
+		s.startWatchdog()
+	}
+
 	s.Option.funcSingle(optionRunWait, func() {
 		sigChan := make(chan os.Signal, 3)
-		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
-		<-sigChan
+		if notify {
+			signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt, syscall.SIGHUP)
+		} else {
+			signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
+		}
+		for sig := range sigChan {
+			if notify && sig == syscall.SIGHUP {
+				s.handleReloadSignal()
+				continue
+			}
+			break
+		}
 	})()
 
+	if notify {
+		s.stopWatchdog()
+		_ = sdNotify("STOPPING=1")
+	}
+
 	return s.i.Stop(s)
 }
 
+// OnReload registers the callback invoked when this process receives SIGHUP
+// while running with Type=notify; RELOADING=1/READY=1 are sent to systemd
+// around the callback so `systemctl reload` blocks until it returns.
+func (s *systemd) OnReload(cb func() error) {
+	s.reloadMu.Lock()
+	s.reload = cb
+	s.reloadMu.Unlock()
+}
+
+func (s *systemd) handleReloadSignal() {
+	s.reloadMu.Lock()
+	cb := s.reload
+	s.reloadMu.Unlock()
+	if cb == nil {
+		return
+	}
+
+	_ = sdNotify("RELOADING=1")
+	err := cb()
+	_ = sdNotify("READY=1")
+	if err != nil && s.errs != nil {
+		s.errs <- err
+	}
+}
+
 func (s *systemd) Status() (Status, error) {
+	if s.useDbus() {
+		// useDbus already verified the bus is reachable; any error returned
+		// from here on (including "service in failed state") is a real
+		// result, not a reason to fall back and re-shell-out.
+		return s.statusDbus()
+	}
+
 	exitCode, out, err := s.runWithOutput("systemctl", "is-active", s.unitName())
 	if exitCode == 0 && err != nil {
 		return StatusUnknown, err
@@ -278,17 +405,35 @@ func (s *systemd) Status() (Status, error) {
 }
 
 func (s *systemd) Start() error {
+	if s.useDbus() {
+		return s.startDbus()
+	}
 	return s.runAction("start")
 }
 
 func (s *systemd) Stop() error {
+	if s.useDbus() {
+		return s.stopDbus()
+	}
 	return s.runAction("stop")
 }
 
 func (s *systemd) Restart() error {
+	if s.useDbus() {
+		return s.restartDbus()
+	}
 	return s.runAction("restart")
 }
 
+// Reload asks systemd to run the unit's ExecReload without going through a
+// full stop/start cycle. It does not re-read the unit file from disk.
+func (s *systemd) Reload() error {
+	if s.useDbus() {
+		return s.reloadDbus()
+	}
+	return s.run("reload", s.unitName())
+}
+
 func (s *systemd) runWithOutput(command string, arguments ...string) (int, string, error) {
 	if s.isUserService() {
 		arguments = append(arguments, "--user")
@@ -307,6 +452,74 @@ func (s *systemd) runAction(action string) error {
 	return s.run(action, s.unitName())
 }
 
+// enableAction runs "enable"/"disable", preferring D-Bus when it's reachable.
+func (s *systemd) enableAction(action string) error {
+	if s.useDbus() {
+		return s.enableDisableDbus(action)
+	}
+	return s.runAction(action)
+}
+
+// enableNowUnit enables and immediately starts an arbitrary unit (not
+// necessarily the main .service), preferring D-Bus when it's reachable.
+// Used for companion socket/timer/path units, which installCompanionUnits
+// wants running right away rather than inert until next boot.
+func (s *systemd) enableNowUnit(unit string) error {
+	if s.useDbus() {
+		if err := s.enableDisableUnitDbus(unit, "enable"); err != nil {
+			return err
+		}
+		return s.startUnitDbus(unit)
+	}
+	return s.run("enable", "--now", unit)
+}
+
+// disableNowUnit stops and disables an arbitrary unit, preferring D-Bus
+// when it's reachable. The mirror of enableNowUnit for teardown.
+func (s *systemd) disableNowUnit(unit string) error {
+	if s.useDbus() {
+		if err := s.stopUnitDbus(unit); err != nil {
+			return err
+		}
+		return s.enableDisableUnitDbus(unit, "disable")
+	}
+	return s.run("disable", "--now", unit)
+}
+
+// unitNotLoadedPhrases are the substrings systemctl and D-Bus use to report
+// that a unit has no unit file to act on - seen when stopping or disabling a
+// unit that was already removed or never installed in the first place.
+var unitNotLoadedPhrases = []string{
+	"does not exist",
+	"not loaded",
+	"no such file or directory",
+}
+
+// isUnitNotLoadedErr reports whether err looks like systemd's way of saying
+// there's no unit file to act on, so callers that want idempotent teardown
+// (e.g. uninstallCompanionUnits) can treat it the same as success.
+func isUnitNotLoadedErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, phrase := range unitNotLoadedPhrases {
+		if strings.Contains(msg, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// daemonReload tells systemd to reload unit files from disk, preferring
+// D-Bus when it's reachable.
+func (s *systemd) daemonReload() error {
+	if s.useDbus() {
+		return s.daemonReloadDbus()
+	}
+	return s.run("daemon-reload")
+}
+
 const systemdScript = `[Unit]
 Description={{.Description}}
 ConditionFileIsExecutable={{.Path|cmdEscape}}
@@ -316,6 +529,7 @@ ConditionFileIsExecutable={{.Path|cmdEscape}}
 [Service]
 StartLimitInterval=5
 StartLimitBurst=10
+{{if .Type}}Type={{.Type}}{{end}}
 ExecStart={{.Path|cmdEscape}}{{range .Arguments}} {{.|cmd}}{{end}}
 {{if .ChRoot}}RootDirectory={{.ChRoot|cmd}}{{end}}
 {{if .WorkingDirectory}}WorkingDirectory={{.WorkingDirectory|cmdEscape}}{{end}}
@@ -335,10 +549,27 @@ EnvironmentFile=-/etc/sysconfig/{{.Name}}
 {{if .KillSignal }}KillSignal={{.KillSignal}}{{end}}
 {{if .TimeoutStopSec }}TimeoutStopSec={{.TimeoutStopSec}}{{end}}
 
+{{if .ProtectSystem}}ProtectSystem={{.ProtectSystem}}{{end}}
+{{if .ProtectHome}}ProtectHome={{.ProtectHome}}{{end}}
+{{if .PrivateTmp}}PrivateTmp=true{{end}}
+{{if .PrivateDevices}}PrivateDevices=true{{end}}
+{{if .NoNewPrivileges}}NoNewPrivileges=true{{end}}
+{{if .CapabilityBoundingSet}}CapabilityBoundingSet={{.CapabilityBoundingSet}}{{end}}
+{{if .AmbientCapabilities}}AmbientCapabilities={{.AmbientCapabilities}}{{end}}
+{{if .ReadWritePaths}}ReadWritePaths={{.ReadWritePaths}}{{end}}
+{{if .ReadOnlyPaths}}ReadOnlyPaths={{.ReadOnlyPaths}}{{end}}
+{{if .SystemCallFilter}}SystemCallFilter={{.SystemCallFilter}}{{end}}
+{{if .RestrictAddressFamilies}}RestrictAddressFamilies={{.RestrictAddressFamilies}}{{end}}
+{{if .MemoryMax}}MemoryMax={{.MemoryMax}}{{end}}
+{{if .CPUQuota}}CPUQuota={{.CPUQuota}}{{end}}
+{{if .TasksMax}}TasksMax={{.TasksMax}}{{end}}
+{{if .OOMScoreAdjust}}OOMScoreAdjust={{.OOMScoreAdjust}}{{end}}
+
 {{range $k, $v := .EnvVars -}}
 Environment={{$k}}={{$v}}
 {{end -}}
 
+{{if .EnableMainUnit}}
 [Install]
 WantedBy=multi-user.target
-`
+{{end}}`
@@ -0,0 +1,29 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package syscore
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsUnitNotLoadedErr(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("Failed to disable unit: Unit file myunit.service does not exist."), true},
+		{errors.New("Unit myunit.service not loaded."), true},
+		{errors.New("stat /etc/systemd/system/myunit.service: no such file or directory"), true},
+		{errors.New("Failed to stop unit: Access denied"), false},
+	}
+
+	for _, tc := range cases {
+		if got := isUnitNotLoadedErr(tc.err); got != tc.want {
+			t.Errorf("isUnitNotLoadedErr(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
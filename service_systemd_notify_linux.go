@@ -0,0 +1,143 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package syscore
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// optionType selects the systemd Service Type= directive (simple, notify,
+// forking, oneshot, dbus, ...). Type=notify opts this service into the
+// sd_notify readiness/watchdog protocol in Run().
+const (
+	optionType        = "Type"
+	optionTypeDefault = "simple"
+)
+
+// notifySocketName rewrites $NOTIFY_SOCKET's value into the name net.UnixAddr
+// expects, translating the abstract-namespace form (a leading '@' standing
+// in for the NUL byte Linux uses for abstract sockets) that systemd sets by
+// default.
+func notifySocketName(addr string) string {
+	if addr != "" && addr[0] == '@' {
+		return "\x00" + addr[1:]
+	}
+	return addr
+}
+
+// sdNotify sends a newline-separated state message to $NOTIFY_SOCKET. It is
+// a silent no-op when NOTIFY_SOCKET isn't set, matching libsystemd's
+// sd_notify.
+func sdNotify(state string) error {
+	raw := os.Getenv("NOTIFY_SOCKET")
+	if raw == "" {
+		return nil
+	}
+	addr := notifySocketName(raw)
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// startWatchdog spawns the WATCHDOG=1 keepalive goroutine described by
+// $WATCHDOG_USEC, if systemd set one for this unit. It is a no-op otherwise,
+// including when $WATCHDOG_PID names a different process: per the sd_notify
+// watchdog contract, a process that inherited the environment across a
+// fork/exec must not act on a watchdog meant for its parent.
+func (s *systemd) startWatchdog() {
+	pid, err := strconv.Atoi(os.Getenv("WATCHDOG_PID"))
+	if err != nil || pid != os.Getpid() {
+		return
+	}
+
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+
+	s.watchdogMu.Lock()
+	if s.petCh == nil {
+		s.petCh = make(chan struct{}, 1)
+	}
+	pet := s.petCh
+	stop := make(chan struct{})
+	s.watchdogStop = stop
+	s.watchdogMu.Unlock()
+
+	// systemd recommends pinging at roughly half the configured interval.
+	interval := time.Duration(usec/2) * time.Microsecond
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-pet:
+				_ = sdNotify("WATCHDOG=1")
+			case <-ticker.C:
+				if s.healthOK() {
+					_ = sdNotify("WATCHDOG=1")
+				}
+			}
+		}
+	}()
+}
+
+func (s *systemd) stopWatchdog() {
+	s.watchdogMu.Lock()
+	stop := s.watchdogStop
+	s.watchdogStop = nil
+	s.watchdogMu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+}
+
+func (s *systemd) healthOK() bool {
+	s.healthMu.Lock()
+	check := s.healthCheck
+	s.healthMu.Unlock()
+	if check == nil {
+		return true
+	}
+	return check() == nil
+}
+
+// Pet sends an immediate WATCHDOG=1 keepalive, letting the app gate it on
+// its own event loop instead of waiting for the next ticker tick.
+func (s *systemd) Pet() {
+	s.watchdogMu.Lock()
+	pet := s.petCh
+	s.watchdogMu.Unlock()
+	if pet == nil {
+		return
+	}
+	select {
+	case pet <- struct{}{}:
+	default:
+	}
+}
+
+// ReloadHealth installs a health check consulted before each ticker-driven
+// WATCHDOG=1 keepalive; when it returns an error, the watchdog ping is
+// skipped so systemd can restart a unit that has stopped being healthy
+// rather than one that merely stopped calling Pet.
+func (s *systemd) ReloadHealth(check func() error) {
+	s.healthMu.Lock()
+	s.healthCheck = check
+	s.healthMu.Unlock()
+}